@@ -0,0 +1,50 @@
+package gcsdriver
+
+import (
+	"io"
+	"time"
+)
+
+// ObjectInfo is a backend-agnostic description of a stored object or
+// pseudo-directory, as returned by Backend.Stat and Backend.List.
+type ObjectInfo struct {
+	Name    string
+	Size    int64
+	IsDir   bool
+	ModTime time.Time
+}
+
+// Backend is the object-storage surface the FTP driver needs. It is modeled
+// directly on goftp's Driver methods so a ftpDriver can forward to whichever
+// Backend it's configured with, letting the same FTP front end run over
+// multiple clouds. GoogleStorageDriver is the GCS-backed implementation;
+// fsBackend is a local-filesystem one, useful for tests.
+type Backend interface {
+	// Stat returns metadata for the object or pseudo-directory named key.
+	Stat(bucket, key string) (ObjectInfo, error)
+
+	// List invokes callback once per immediate child of prefix.
+	List(bucket, prefix string, callback func(ObjectInfo) error) error
+
+	// Get opens key for reading starting at offset, returning the number
+	// of bytes remaining from there.
+	Get(bucket, key string, offset int64) (int64, io.ReadCloser, error)
+
+	// Put uploads data to key, appending to any existing object when
+	// appendData is true, and returns the final object size.
+	Put(bucket, key string, data io.Reader, appendData bool) (int64, error)
+
+	// Delete removes a single object.
+	Delete(bucket, key string) error
+
+	// DeleteAll removes every object under prefix.
+	DeleteAll(bucket, prefix string) error
+
+	// Rename moves srcKey to destKey. Keys are given without a trailing
+	// "/"; when srcKey names a directory rather than an object, it is moved
+	// as a directory.
+	Rename(bucket, srcKey, destKey string) error
+
+	// MakeDir creates a pseudo-directory marker at key.
+	MakeDir(bucket, key string) error
+}
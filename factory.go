@@ -0,0 +1,62 @@
+package gcsdriver
+
+import (
+	"fmt"
+
+	"github.com/goftp/server"
+)
+
+// backendDriverFactory adapts any Backend into a server.DriverFactory.
+type backendDriverFactory struct {
+	backend       Backend
+	bucket        string
+	bucketPerUser bool
+}
+
+func (f *backendDriverFactory) NewDriver() (server.Driver, error) {
+	return newBackendDriver(f.backend, f.bucket, f.bucketPerUser), nil
+}
+
+// NewFilesystemDriverFactory builds an FTP driver factory backed by a local
+// directory tree rooted at root instead of a cloud provider. Useful for
+// tests, or for running the FTP front end without a cloud dependency.
+func NewFilesystemDriverFactory(root, bucket string, bucketPerUser bool) server.DriverFactory {
+	return &backendDriverFactory{
+		backend:       NewFilesystemBackend(root),
+		bucket:        bucket,
+		bucketPerUser: bucketPerUser,
+	}
+}
+
+// BackendConfig configures whichever backend NewDriverFactory selects.
+type BackendConfig struct {
+	Bucket        string
+	BucketPerUser bool
+
+	// GCS configures the "gcs" backend. Bucket/BucketPerUser above
+	// override the same-named fields on GCS.
+	GCS GoogleStorageDriverFactory
+
+	// FSRoot configures the "fs" backend: the local directory under which
+	// every bucket is stored.
+	FSRoot string
+}
+
+// NewDriverFactory selects a Backend by name ("gcs" or "fs") and returns a
+// driver factory for it, so a deployment can switch storage providers
+// through config rather than code. cfg is taken by pointer because
+// GoogleStorageDriverFactory holds a lazily-initialized semaphore that must
+// not be copied once in use.
+func NewDriverFactory(name string, cfg *BackendConfig) (server.DriverFactory, error) {
+	switch name {
+	case "gcs":
+		gcs := &cfg.GCS
+		gcs.Bucket = cfg.Bucket
+		gcs.BucketPerUser = cfg.BucketPerUser
+		return gcs, nil
+	case "fs":
+		return NewFilesystemDriverFactory(cfg.FSRoot, cfg.Bucket, cfg.BucketPerUser), nil
+	default:
+		return nil, fmt.Errorf("gcsdriver: unknown backend %q", name)
+	}
+}
@@ -3,16 +3,16 @@ package gcsdriver
 import (
 	"os"
 	"time"
-
-    "github.com/lunny/log"
-    storage "google.golang.org/api/storage/v1"
 )
 
+// FileInfo is a backend-agnostic os.FileInfo (plus goftp's Owner/Group)
+// built from a Backend's ObjectInfo.
 type FileInfo struct {
-	name  string
-	isDir bool
-    User string
-	Object storage.Object
+	name    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+	user    string
 }
 
 func (f *FileInfo) Name() string {
@@ -20,7 +20,7 @@ func (f *FileInfo) Name() string {
 }
 
 func (f *FileInfo) Size() int64 {
-	return (int64)(f.Object.Size)
+	return f.size
 }
 
 func (f *FileInfo) Mode() os.FileMode {
@@ -31,12 +31,7 @@ func (f *FileInfo) Mode() os.FileMode {
 }
 
 func (f *FileInfo) ModTime() time.Time {
-    parsed, err := time.Parse(time.RFC3339, f.Object.Updated)
-    if err != nil {
-        log.Error("Could not parse time for string " + f.Object.Updated)
-        return time.Now()
-    }
-	return parsed
+	return f.modTime
 }
 
 func (f *FileInfo) IsDir() bool {
@@ -48,9 +43,9 @@ func (f *FileInfo) Sys() interface{} {
 }
 
 func (f *FileInfo) Owner() string {
-    return f.User
+	return f.user
 }
 
 func (f *FileInfo) Group() string {
-	return f.User
+	return f.user
 }
@@ -0,0 +1,82 @@
+package gcsdriver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFilesystemBackendRoundTrip(t *testing.T) {
+	root, err := ioutil.TempDir("", "gcsdriver-fsbackend")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+
+	var backend Backend = NewFilesystemBackend(root)
+	const bucket = "test-bucket"
+
+	size, err := backend.Put(bucket, "dir/hello.txt", bytes.NewBufferString("hello world"), false)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if size != int64(len("hello world")) {
+		t.Fatalf("Put returned size %d, want %d", size, len("hello world"))
+	}
+
+	info, err := backend.Stat(bucket, "dir/hello.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.IsDir || info.Size != size {
+		t.Fatalf("Stat returned %+v, want a file of size %d", info, size)
+	}
+
+	if _, err := backend.Stat(bucket, "dir/missing.txt"); err != errNotExist {
+		t.Fatalf("Stat of missing key returned %v, want errNotExist", err)
+	}
+
+	var names []string
+	err = backend.List(bucket, "dir", func(info ObjectInfo) error {
+		names = append(names, info.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(names) != 1 || names[0] != "hello.txt" {
+		t.Fatalf("List returned %v, want [hello.txt]", names)
+	}
+
+	gotSize, rc, err := backend.Get(bucket, "dir/hello.txt", 6)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer rc.Close()
+	if gotSize != size-6 {
+		t.Fatalf("Get returned size %d, want %d", gotSize, size-6)
+	}
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading Get body: %v", err)
+	}
+	if string(data) != "world" {
+		t.Fatalf("Get body at offset 6 = %q, want %q", data, "world")
+	}
+
+	if err := backend.Rename(bucket, "dir/hello.txt", "dir/renamed.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := backend.Stat(bucket, "dir/hello.txt"); err == nil {
+		t.Fatalf("Stat of renamed-away key succeeded, want an error")
+	}
+	if _, err := backend.Stat(bucket, "dir/renamed.txt"); err != nil {
+		t.Fatalf("Stat of renamed key: %v", err)
+	}
+
+	if err := backend.DeleteAll(bucket, "dir"); err != nil {
+		t.Fatalf("DeleteAll: %v", err)
+	}
+	if _, err := backend.Stat(bucket, "dir/renamed.txt"); err != errNotExist {
+		t.Fatalf("Stat after DeleteAll returned %v, want errNotExist", err)
+	}
+}
@@ -0,0 +1,502 @@
+package gcsdriver
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goftp/server"
+	"github.com/lunny/log"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	storage "google.golang.org/api/storage/v1"
+)
+
+const (
+	// DefaultChunkSize is the resumable upload chunk size used when a
+	// GoogleStorageDriverFactory does not set ChunkSize.
+	DefaultChunkSize = 5 * 1024 * 1024
+
+	// ChunkSizeMinBytes is the smallest chunk size GCS's resumable upload
+	// protocol accepts: chunks must be a multiple of 256 KiB.
+	ChunkSizeMinBytes = 256 * 1024
+)
+
+// GoogleStorageDriver is the Backend implementation backed by Google Cloud
+// Storage.
+type GoogleStorageDriver struct {
+	chunkSize  int
+	httpClient *http.Client
+	gcs        *storage.Service
+
+	// sem bounds the number of GCS operations in flight at once; see do().
+	sem chan struct{}
+}
+
+// Implementation of Backend's Stat method for Google Storage
+func (driver *GoogleStorageDriver) Stat(bucket, key string) (ObjectInfo, error) {
+	var entry *storage.Object
+	err := driver.do(func() error {
+		var err error
+		entry, err = driver.gcs.Objects.Get(bucket, key).Do()
+		return err
+	})
+	if err == nil {
+		return objectInfo(entry), nil
+	}
+	if apiErr, ok := err.(*googleapi.Error); !ok || apiErr.Code != http.StatusNotFound {
+		return ObjectInfo{}, fmt.Errorf("gcsdriver: Objects.Get %s/%s failed: %v", bucket, key, err)
+	}
+
+	// Not an object; see whether it's a pseudo-directory, i.e. whether
+	// anything exists with this prefix. MaxResults(1) is enough to know.
+	d := key
+	if d != "" {
+		d = d + "/"
+	}
+	var entries *storage.Objects
+	err = driver.do(func() error {
+		var err error
+		entries, err = driver.gcs.Objects.List(bucket).Prefix(d).Delimiter("/").MaxResults(1).Do()
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("gcsdriver: Objects.List %s/%s failed: %v", bucket, d, err)
+	}
+	if len(entries.Items) > 0 || len(entries.Prefixes) > 0 {
+		return ObjectInfo{Name: key, IsDir: true}, nil
+	}
+	return ObjectInfo{}, errNotExist
+}
+
+// Implementation of Backend's List method for Google Storage. Uses GCS's
+// native prefix+delimiter listing so subdirectories come back as Prefixes and
+// Items holds only the immediate children, and pages through NextPageToken so
+// directories with more than one page of objects aren't truncated.
+func (driver *GoogleStorageDriver) List(bucket, prefix string, callback func(ObjectInfo) error) error {
+	d := prefix
+	if d != "" {
+		d = d + "/"
+	}
+
+	pageToken := ""
+	for {
+		var entries *storage.Objects
+		err := driver.do(func() error {
+			call := driver.gcs.Objects.List(bucket).Prefix(d).Delimiter("/")
+			if pageToken != "" {
+				call = call.PageToken(pageToken)
+			}
+			var err error
+			entries, err = call.Do()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, dirPrefix := range entries.Prefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(dirPrefix, d), "/")
+			if name == "" {
+				continue
+			}
+			if err := callback(ObjectInfo{Name: name, IsDir: true}); err != nil {
+				return err
+			}
+		}
+
+		for _, entry := range entries.Items {
+			name := strings.TrimPrefix(entry.Name, d)
+			if name == "" {
+				continue
+			}
+			if err := callback(objectInfoNamed(name, entry)); err != nil {
+				return err
+			}
+		}
+
+		if entries.NextPageToken == "" {
+			return nil
+		}
+		pageToken = entries.NextPageToken
+	}
+}
+
+// Implementation of Backend's Get method for Google Storage. offset is the
+// byte position goftp resumes from after a REST command; it is honored by
+// issuing the media download with a Range header rather than restarting the
+// object from byte 0.
+func (driver *GoogleStorageDriver) Get(bucket, key string, offset int64) (int64, io.ReadCloser, error) {
+	var res *storage.Object
+	err := driver.do(func() error {
+		var err error
+		res, err = driver.gcs.Objects.Get(bucket, key).Do()
+		return err
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("gcsdriver: Objects.Get %s/%s failed: %v", bucket, key, err)
+	}
+	log.Infof("The media download link for %v/%v is %v.\n\n", bucket, res.Name, res.MediaLink)
+
+	req, err := http.NewRequest("GET", res.MediaLink, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := driver.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+		response.Body.Close()
+		return 0, nil, fmt.Errorf("gcsdriver: download of %s/%s returned status %s", bucket, key, response.Status)
+	}
+
+	size := int64(res.Size) - offset
+	log.Info(size)
+	return size, response.Body, nil
+}
+
+// Implementation of Backend's Put method for Google Storage.
+//
+// The upload is streamed to GCS in driver.chunkSize chunks via the resumable
+// upload protocol, so large FTP transfers don't have to be buffered in RAM.
+// When appendData is true and the destination object already exists, the new
+// bytes are uploaded to a temporary part object and then composed onto the
+// end of the destination, since GCS has no native append operation.
+func (driver *GoogleStorageDriver) Put(bucket, key string, data io.Reader, appendData bool) (int64, error) {
+	if appendData {
+		err := driver.do(func() error {
+			_, err := driver.gcs.Objects.Get(bucket, key).Do()
+			return err
+		})
+		if err == nil {
+			return driver.appendFile(bucket, key, data)
+		}
+		if apiErr, ok := err.(*googleapi.Error); !ok || apiErr.Code != http.StatusNotFound {
+			return 0, fmt.Errorf("gcsdriver: Objects.Get %s/%s failed: %v", bucket, key, err)
+		}
+	}
+
+	return driver.insertObject(bucket, key, data)
+}
+
+// insertObject performs a chunked resumable upload of data to name in bucket,
+// returning the final size of the object. It runs through gate rather than
+// do: data is a non-seekable stream, so retrying the call after a partial
+// read would resend from the wrong offset and silently corrupt the object.
+// google-api-go-client already retries within a single upload's chunks.
+func (driver *GoogleStorageDriver) insertObject(bucket, name string, data io.Reader) (int64, error) {
+	object := &storage.Object{Name: name}
+	var res *storage.Object
+	err := driver.gate(func() error {
+		var err error
+		res, err = driver.gcs.Objects.Insert(bucket, object).
+			Media(data, googleapi.ChunkSize(driver.chunkSize)).
+			Do()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("gcsdriver: Objects.Insert %s/%s failed: %v", bucket, name, err)
+	}
+	log.Infof("Created object %v at location %v\n\n", res.Name, res.SelfLink)
+	return int64(res.Size), nil
+}
+
+// appendFile uploads data to a temporary "<name>.part-<rand>" object and
+// composes it after the existing name object, then deletes the part.
+func (driver *GoogleStorageDriver) appendFile(bucket, name string, data io.Reader) (int64, error) {
+	partName := fmt.Sprintf("%s.part-%d", name, rand.Int63())
+
+	if _, err := driver.insertObject(bucket, partName, data); err != nil {
+		return 0, err
+	}
+
+	compose := &storage.ComposeRequest{
+		SourceObjects: []*storage.ComposeRequestSourceObjects{
+			{Name: name},
+			{Name: partName},
+		},
+	}
+	var res *storage.Object
+	err := driver.do(func() error {
+		var err error
+		res, err = driver.gcs.Objects.Compose(bucket, name, compose).Do()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("gcsdriver: Objects.Compose %s/%s failed: %v", bucket, name, err)
+	}
+
+	err = driver.do(func() error {
+		return driver.gcs.Objects.Delete(bucket, partName).Do()
+	})
+	if err != nil {
+		log.Error("Could not delete temporary part object " + partName)
+	}
+
+	return int64(res.Size), nil
+}
+
+// Implementation of Backend's DeleteAll method for Google Storage
+func (driver *GoogleStorageDriver) DeleteAll(bucket, prefix string) error {
+	pageToken := ""
+	for {
+		var entries *storage.Objects
+		err := driver.do(func() error {
+			call := driver.gcs.Objects.List(bucket).Prefix(prefix)
+			if pageToken != "" {
+				call = call.PageToken(pageToken)
+			}
+			var err error
+			entries, err = call.Do()
+			return err
+		})
+		if err == io.EOF {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries.Items {
+			name := entry.Name
+			err = driver.do(func() error {
+				return driver.gcs.Objects.Delete(bucket, name).Do()
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if entries.NextPageToken == "" {
+			return nil
+		}
+		pageToken = entries.NextPageToken
+	}
+}
+
+// Implementation of Backend's Delete method for Google Storage
+func (driver *GoogleStorageDriver) Delete(bucket, key string) error {
+	return driver.do(func() error {
+		return driver.gcs.Objects.Delete(bucket, key).Do()
+	})
+}
+
+// Implementation of Backend's Rename method for Google Storage
+func (driver *GoogleStorageDriver) Rename(bucket, srcKey, destKey string) error {
+	from, to := srcKey, destKey
+
+	err := driver.do(func() error {
+		_, err := driver.gcs.Objects.Get(bucket, from).Do()
+		return err
+	})
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+		from = srcKey + "/"
+		to = destKey + "/"
+		err = driver.do(func() error {
+			_, err := driver.gcs.Objects.Get(bucket, from).Do()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		var entries *storage.Objects
+		err = driver.do(func() error {
+			var err error
+			entries, err = driver.gcs.Objects.List(bucket).Prefix(from).Do()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries.Items {
+			newName := strings.Replace(entry.Name, from, to, 1)
+			name := entry.Name
+			err = driver.do(func() error {
+				_, err := driver.gcs.Objects.Copy(bucket, name, bucket, newName, nil).Do()
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			err = driver.do(func() error {
+				return driver.gcs.Objects.Delete(bucket, name).Do()
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = driver.do(func() error {
+		_, err := driver.gcs.Objects.Copy(bucket, from, bucket, to, nil).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return driver.do(func() error {
+		return driver.gcs.Objects.Delete(bucket, from).Do()
+	})
+}
+
+// Implementation of Backend's MakeDir method for Google Storage
+func (driver *GoogleStorageDriver) MakeDir(bucket, key string) error {
+	dir := key + "/"
+	object := &storage.Object{Name: dir}
+	return driver.do(func() error {
+		_, err := driver.gcs.Objects.Insert(bucket, object).Media(strings.NewReader("")).Do()
+		return err
+	})
+}
+
+// objectInfo converts a storage.Object into the backend-agnostic ObjectInfo,
+// parsing its RFC3339 Updated timestamp.
+func objectInfo(o *storage.Object) ObjectInfo {
+	return objectInfoNamed(o.Name, o)
+}
+
+func objectInfoNamed(name string, o *storage.Object) ObjectInfo {
+	modTime, err := time.Parse(time.RFC3339, o.Updated)
+	if err != nil {
+		log.Error("Could not parse time for string " + o.Updated)
+		modTime = time.Now()
+	}
+	return ObjectInfo{
+		Name:    name,
+		Size:    int64(o.Size),
+		ModTime: modTime,
+	}
+}
+
+// Factory for the GCS-backed driver
+type GoogleStorageDriverFactory struct {
+	Bucket        string
+	BucketPerUser bool
+
+	// Credentials selects how the factory authenticates with GCS; see the
+	// Credentials doc comment for the supported combinations.
+	Credentials Credentials
+
+	// Scope is the OAuth2 scope requested for the GCS client, e.g.
+	// storage.DevstorageReadOnlyScope for a read-only driver. Defaults to
+	// storage.DevstorageFullControlScope.
+	Scope string
+
+	// ChunkSize is the resumable upload chunk size used by Put. It
+	// defaults to DefaultChunkSize and is rounded up to ChunkSizeMinBytes
+	// when set below that, since GCS requires chunks to align to 256 KiB.
+	ChunkSize int
+
+	// MaxConcurrency caps the number of GCS operations the driver issues at
+	// once, across all connected FTP clients. Defaults to
+	// DefaultMaxConcurrency, and is raised to MinMaxConcurrency when set
+	// lower than that.
+	MaxConcurrency int
+
+	// semOnce and sem lazily build a single semaphore shared by every
+	// GoogleStorageDriver this factory hands out. goftp calls NewDriver
+	// once per accepted connection, so without this each FTP client would
+	// get its own independent MaxConcurrency budget instead of sharing one.
+	semOnce sync.Once
+	sem     chan struct{}
+}
+
+// NewGoogleStorageDriverFactory builds a factory authenticating with the
+// service-account JSON key file at serviceAccountPath.
+func NewGoogleStorageDriverFactory(bucket, serviceAccountPath string, bucketPerUser bool) server.DriverFactory {
+	return &GoogleStorageDriverFactory{
+		Bucket:        bucket,
+		BucketPerUser: bucketPerUser,
+		Credentials:   Credentials{ServiceAccountPath: serviceAccountPath},
+	}
+}
+
+// NewGoogleStorageDriverFactoryWithJSON builds a factory authenticating with
+// a service-account JSON key passed directly, e.g. from an environment
+// variable rather than a file on disk.
+func NewGoogleStorageDriverFactoryWithJSON(bucket string, serviceAccountJSON []byte, bucketPerUser bool) server.DriverFactory {
+	return &GoogleStorageDriverFactory{
+		Bucket:        bucket,
+		BucketPerUser: bucketPerUser,
+		Credentials:   Credentials{ServiceAccountJSON: serviceAccountJSON},
+	}
+}
+
+// NewGoogleStorageDriverFactoryWithKey builds a factory authenticating with
+// an explicit private key and client email, for setups that split a service
+// account's credentials across two separate values instead of one JSON blob.
+func NewGoogleStorageDriverFactoryWithKey(bucket string, privateKey []byte, clientEmail string, bucketPerUser bool) server.DriverFactory {
+	return &GoogleStorageDriverFactory{
+		Bucket:        bucket,
+		BucketPerUser: bucketPerUser,
+		Credentials:   Credentials{PrivateKey: privateKey, ClientEmail: clientEmail},
+	}
+}
+
+// NewGoogleStorageDriverFactoryWithDefaultCredentials builds a factory that
+// authenticates via google.DefaultClient, picking up Application Default
+// Credentials or GKE workload identity instead of an explicit key.
+func NewGoogleStorageDriverFactoryWithDefaultCredentials(bucket string, bucketPerUser bool) server.DriverFactory {
+	return &GoogleStorageDriverFactory{
+		Bucket:        bucket,
+		BucketPerUser: bucketPerUser,
+	}
+}
+
+func (factory *GoogleStorageDriverFactory) NewDriver() (server.Driver, error) {
+	scope := factory.Scope
+	if scope == "" {
+		scope = storage.DevstorageFullControlScope
+	}
+
+	httpClient, err := factory.Credentials.httpClient(context.Background(), scope)
+	if err != nil {
+		return nil, err
+	}
+
+	gcs, err := storage.New(httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("gcsdriver: unable to create storage service: %v", err)
+	}
+
+	chunkSize := factory.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	} else if chunkSize < ChunkSizeMinBytes {
+		chunkSize = ChunkSizeMinBytes
+	}
+
+	factory.semOnce.Do(func() {
+		maxConcurrency := factory.MaxConcurrency
+		if maxConcurrency <= 0 {
+			maxConcurrency = DefaultMaxConcurrency
+		} else if maxConcurrency < MinMaxConcurrency {
+			maxConcurrency = MinMaxConcurrency
+		}
+		factory.sem = make(chan struct{}, maxConcurrency)
+	})
+
+	backend := &GoogleStorageDriver{
+		httpClient: httpClient,
+		gcs:        gcs,
+		chunkSize:  chunkSize,
+		sem:        factory.sem,
+	}
+
+	return newBackendDriver(backend, factory.Bucket, factory.BucketPerUser), nil
+}
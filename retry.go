@@ -0,0 +1,87 @@
+package gcsdriver
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// DefaultMaxConcurrency is used when a GoogleStorageDriverFactory does
+	// not set MaxConcurrency.
+	DefaultMaxConcurrency = 50
+
+	// MinMaxConcurrency is the smallest MaxConcurrency a factory is allowed
+	// to run with; smaller values are clamped up to it.
+	MinMaxConcurrency = 25
+
+	retryAttempts  = 5
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// isRetryableError reports whether err is a transient failure worth retrying:
+// a 429/5xx response from GCS, or an unexpected EOF from a dropped
+// connection mid-transfer.
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		switch apiErr.Code {
+		case 429, 500, 502, 503, 504:
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before retry attempt n (0-based): truncated
+// exponential backoff, full jitter, capped at retryMaxDelay.
+func backoff(attempt int) time.Duration {
+	d := float64(retryBaseDelay) * math.Pow(2, float64(attempt))
+	if d > float64(retryMaxDelay) {
+		d = float64(retryMaxDelay)
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// do runs op, retrying transient GCS errors with truncated exponential
+// backoff (base 250ms, cap ~30s, up to retryAttempts tries), and bounds the
+// number of GCS operations in flight via driver.sem so a burst of FTP
+// clients can't open thousands of simultaneous HTTPS connections.
+//
+// do must only wrap calls whose op is safe to invoke more than once. Calls
+// that stream a non-seekable io.Reader (resumable Insert uploads) are not:
+// a retry would resend from wherever the reader was left after the failed
+// attempt, silently producing a truncated object. Those go through gate
+// instead, which leaves retrying to the google-api-go-client library's own
+// per-chunk backoff.
+func (driver *GoogleStorageDriver) do(op func() error) error {
+	driver.sem <- struct{}{}
+	defer func() { <-driver.sem }()
+
+	var err error
+	for attempt := 0; attempt < retryAttempts; attempt++ {
+		err = op()
+		if !isRetryableError(err) {
+			return err
+		}
+		time.Sleep(backoff(attempt))
+	}
+	return err
+}
+
+// gate runs op once after acquiring driver.sem, without retrying. See do's
+// doc comment for why streaming uploads use this instead.
+func (driver *GoogleStorageDriver) gate(op func() error) error {
+	driver.sem <- struct{}{}
+	defer func() { <-driver.sem }()
+	return op()
+}
@@ -0,0 +1,57 @@
+package gcsdriver
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"generic error", errors.New("boom"), false},
+		{"429 too many requests", &googleapi.Error{Code: 429}, true},
+		{"500 internal error", &googleapi.Error{Code: 500}, true},
+		{"502 bad gateway", &googleapi.Error{Code: 502}, true},
+		{"503 unavailable", &googleapi.Error{Code: 503}, true},
+		{"504 gateway timeout", &googleapi.Error{Code: 504}, true},
+		{"404 not found", &googleapi.Error{Code: 404}, false},
+		{"403 forbidden", &googleapi.Error{Code: 403}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isRetryableError(c.err); got != c.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < retryAttempts; attempt++ {
+		d := backoff(attempt)
+		if d < 0 {
+			t.Fatalf("backoff(%d) = %v, want >= 0", attempt, d)
+		}
+		if d > retryMaxDelay {
+			t.Fatalf("backoff(%d) = %v, want <= %v", attempt, d, retryMaxDelay)
+		}
+	}
+}
+
+func TestBackoffCapsAtRetryMaxDelay(t *testing.T) {
+	// A large attempt number would overflow the exponential term well past
+	// retryMaxDelay if the cap weren't applied.
+	d := backoff(retryAttempts + 20)
+	if d > retryMaxDelay {
+		t.Fatalf("backoff did not cap: got %v, want <= %v", d, retryMaxDelay)
+	}
+}